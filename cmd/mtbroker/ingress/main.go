@@ -25,16 +25,21 @@ import (
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
-	cloudevents "github.com/cloudevents/sdk-go/v1"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 	"github.com/google/uuid"
 	"github.com/kelseyhightower/envconfig"
 	"go.opencensus.io/stats/view"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 
 	cmdbroker "knative.dev/eventing/cmd/mtbroker"
-	"knative.dev/eventing/pkg/kncloudevents"
+	eventingclient "knative.dev/eventing/pkg/client/injection/client"
+	brokerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1beta1/broker"
 	broker "knative.dev/eventing/pkg/mtbroker"
 	"knative.dev/eventing/pkg/mtbroker/ingress"
+	"knative.dev/eventing/pkg/mtbroker/ingress/eventtype"
+	"knative.dev/eventing/pkg/mtbroker/ingress/readiness"
 	cmpresources "knative.dev/eventing/pkg/reconciler/configmappropagation/resources"
 	namespaceresources "knative.dev/eventing/pkg/reconciler/namespace/resources"
 	"knative.dev/eventing/pkg/tracing"
@@ -48,7 +53,6 @@ import (
 	"knative.dev/pkg/metrics"
 	"knative.dev/pkg/signals"
 	"knative.dev/pkg/system"
-	pkgtracing "knative.dev/pkg/tracing"
 	tracingconfig "knative.dev/pkg/tracing/config"
 )
 
@@ -76,6 +80,29 @@ type envConfig struct {
 	PodName       string `envconfig:"POD_NAME" required:"true"`
 	ContainerName string `envconfig:"CONTAINER_NAME" required:"true"`
 	Port          int    `envconfig:"INGRESS_PORT" default:"8080"`
+
+	// Protocol selects the CloudEvents protocol binding the ingress
+	// receives on. Defaults to "http"; other values require the binary to
+	// be built with the matching build tag (see pkg/mtbroker/ingress).
+	Protocol string `envconfig:"PROTOCOL" default:"http"`
+
+	// AutoCreateEventTypes, when true, makes the ingress reconcile an
+	// EventType for every distinct tuple of event attributes it dispatches.
+	AutoCreateEventTypes bool `envconfig:"AUTO_CREATE_EVENT_TYPES" default:"false"`
+
+	// ReadinessProbeWindow bounds how long /readyz accepts a channel as
+	// reachable after the last successful dispatch (and, before the first
+	// dispatch, how long the startup grace period lasts).
+	ReadinessProbeWindow time.Duration `envconfig:"READINESS_PROBE_WINDOW" default:"60s"`
+
+	// IngressQPS and IngressBurst bound each broker's own token bucket; exceeding
+	// them gets a request 429'd. IngressMaxInFlight bounds the number of
+	// requests being dispatched concurrently across every broker this
+	// process serves, so one tenant can't monopolize the ingress's
+	// connections to the channel.
+	IngressQPS         float64 `envconfig:"INGRESS_QPS" default:"1000"`
+	IngressBurst       int     `envconfig:"INGRESS_BURST" default:"1000"`
+	IngressMaxInFlight int64   `envconfig:"INGRESS_MAX_IN_FLIGHT" default:"1000"`
 }
 
 func main() {
@@ -106,8 +133,11 @@ func main() {
 
 	ctx, informers := injection.Default.SetupInformers(ctx, cfg)
 
+	brokerLister := ingress.NewBrokerLister(brokerinformer.Get(ctx).Lister())
+
 	loggingConfigMapName := cmpresources.MakeCopyConfigMapName(namespaceresources.DefaultConfigMapPropagationName, logging.ConfigMapName())
 	metricsConfigMapName := cmpresources.MakeCopyConfigMapName(namespaceresources.DefaultConfigMapPropagationName, metrics.ConfigMapName())
+	tracingConfigMapName := cmpresources.MakeCopyConfigMapName(namespaceresources.DefaultConfigMapPropagationName, tracingconfig.ConfigName)
 
 	loggingConfig, err := cmdbroker.GetLoggingConfig(ctx, system.Namespace(), loggingConfigMapName)
 	if err != nil {
@@ -119,9 +149,12 @@ func main() {
 
 	logger.Info("Starting the Broker Ingress")
 
+	readinessTracker := readiness.NewTracker(env.ReadinessProbeWindow, loggingConfigMapName, metricsConfigMapName, tracingConfigMapName)
+
 	// Watch the logging config map and dynamically update logging levels.
 	configMapWatcher := configmap.NewInformedWatcher(kubeclient.Get(ctx), system.Namespace())
 	// Watch the observability config map and dynamically update metrics exporter.
+	// Also marks the readiness tracker once the first snapshot has been delivered.
 	updateFunc, err := metrics.UpdateExporterFromConfigMapWithOpts(metrics.ExporterOptions{
 		Component:      component,
 		PrometheusPort: defaultMetricsPort,
@@ -129,50 +162,109 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to create metrics exporter update function", zap.Error(err))
 	}
-	configMapWatcher.Watch(metricsConfigMapName, updateFunc)
+	configMapWatcher.Watch(metricsConfigMapName, func(cm *corev1.ConfigMap) {
+		updateFunc(cm)
+		readinessTracker.MarkConfigMapSeen(metricsConfigMapName)
+	})
 	// TODO change the component name to broker once Stackdriver metrics are approved.
-	// Watch the observability config map and dynamically update request logs.
-	configMapWatcher.Watch(loggingConfigMapName, logging.UpdateLevelFromConfigMap(sl, atomicLevel, component))
+	// Watch the observability config map and dynamically update request logs. Also
+	// marks the readiness tracker once the first snapshot has been delivered.
+	configMapWatcher.Watch(loggingConfigMapName, func(cm *corev1.ConfigMap) {
+		logging.UpdateLevelFromConfigMap(sl, atomicLevel, component)(cm)
+		readinessTracker.MarkConfigMapSeen(loggingConfigMapName)
+	})
+	// Marks the readiness tracker once the tracing config map watch registered
+	// by SetupDynamicPublishing below has delivered its first snapshot;
+	// InformedWatcher supports multiple independent observers per config map.
+	configMapWatcher.Watch(tracingConfigMapName, func(*corev1.ConfigMap) {
+		readinessTracker.MarkConfigMapSeen(tracingConfigMapName)
+	})
 
 	bin := tracing.BrokerIngressName(tracing.BrokerIngressNameArgs{
 		Namespace:  system.Namespace(),
 		BrokerName: "cluster",
 	})
-	if err = tracing.SetupDynamicPublishing(sl, configMapWatcher, bin,
-		cmpresources.MakeCopyConfigMapName(namespaceresources.DefaultConfigMapPropagationName, tracingconfig.ConfigName)); err != nil {
+	if err = tracing.SetupDynamicPublishing(sl, configMapWatcher, bin, tracingConfigMapName); err != nil {
 		logger.Fatal("Error setting up trace publishing", zap.Error(err))
 	}
 
-	httpTransport, err := cloudevents.NewHTTPTransport(cloudevents.WithBinaryEncoding(), cloudevents.WithMiddleware(pkgtracing.HTTPSpanMiddleware))
-	if err != nil {
-		logger.Fatal("Unable to create CE transport", zap.Error(err))
-	}
+	reporter := ingress.NewStatsReporter(env.ContainerName, kmeta.ChildName(env.PodName, uuid.New().String()))
 
-	// Liveness check.
-	httpTransport.Handler = http.NewServeMux()
-	httpTransport.Port = &env.Port
-	httpTransport.Handler.HandleFunc("/healthz", func(writer http.ResponseWriter, _ *http.Request) {
-		writer.WriteHeader(http.StatusOK)
+	// Constructed before the protocol (and the Handler that holds the same
+	// reference) so its Middleware can be wired into the HTTP binding ahead
+	// of event decoding.
+	limiter := ingress.NewLimiter(ingress.LimiterConfig{
+		QPS:         env.IngressQPS,
+		Burst:       env.IngressBurst,
+		MaxInFlight: env.IngressMaxInFlight,
 	})
 
-	connectionArgs := kncloudevents.ConnectionArgs{
+	protocol, err := ingress.NewProtocol(ctx, env.Protocol, ingress.ProtocolEnv{
+		Port:                env.Port,
 		MaxIdleConns:        defaultMaxIdleConnections,
 		MaxIdleConnsPerHost: defaultMaxIdleConnectionsPerHost,
+		Middleware:          []cehttp.Middleware{limiter.Middleware(reporter)},
+	})
+	if err != nil {
+		logger.Fatal("Unable to create CE protocol", zap.Error(err))
 	}
-	ceClient, err := kncloudevents.NewDefaultClientGivenHttpTransport(
-		httpTransport,
-		&connectionArgs)
+
+	// Liveness check. Only the HTTP binding has a ServeMux to hang it off of;
+	// other bindings skip it and rely on Kubernetes' process-level liveness
+	// handling instead.
+	if httpProtocol, ok := protocol.(*cehttp.Protocol); ok {
+		httpProtocol.Handler = http.NewServeMux()
+		httpProtocol.Handler.HandleFunc("/healthz", func(writer http.ResponseWriter, _ *http.Request) {
+			writer.WriteHeader(http.StatusOK)
+		})
+	}
+
+	ceClient, err := cloudevents.NewClient(protocol, cloudevents.WithUUIDs(), cloudevents.WithTimeNow())
 	if err != nil {
 		logger.Fatal("Unable to create CE client", zap.Error(err))
 	}
 
-	reporter := ingress.NewStatsReporter(env.ContainerName, kmeta.ChildName(env.PodName, uuid.New().String()))
+	// Dispatch to the channel always goes over HTTP, regardless of which
+	// Protocol ceClient above receives on, since a channel address is
+	// always an HTTP(S) URL and non-HTTP bindings are consume-only.
+	sender, err := ingress.NewHTTPSender(ingress.ProtocolEnv{
+		MaxIdleConns:        defaultMaxIdleConnections,
+		MaxIdleConnsPerHost: defaultMaxIdleConnectionsPerHost,
+	})
+	if err != nil {
+		logger.Fatal("Unable to create CE sender", zap.Error(err))
+	}
 
 	h := &ingress.Handler{
 		Logger:    logger,
 		CeClient:  ceClient,
+		Sender:    sender,
 		Reporter:  reporter,
 		Defaulter: broker.TTLDefaulter(logger, defaultTTL),
+		Brokers:   brokerLister,
+		Limiter:   limiter,
+		Readiness: readinessTracker,
+	}
+
+	if env.AutoCreateEventTypes {
+		recorder, err := eventtype.NewRecorder(eventingclient.Get(ctx), logger, 0)
+		if err != nil {
+			logger.Fatal("Unable to create EventType recorder", zap.Error(err))
+		}
+		h.Recorder = recorder
+	}
+
+	// The batched JSON format (application/cloudevents-batch+json) isn't a
+	// single Event the CE client's receiver can decode, so it gets its own
+	// path on the same mux rather than going through CeClient.StartReceive —
+	// which also means it bypasses the protocol's middleware chain, so the
+	// rate limiter is applied to it explicitly here. Batches are POSTed to
+	// "/batch/<namespace>/<broker>"; the "/batch" prefix is stripped so the
+	// limiter and ServeBatchHTTP resolve the broker from the same
+	// "/<namespace>/<broker>" path as single events.
+	if httpProtocol, ok := protocol.(*cehttp.Protocol); ok && httpProtocol.Handler != nil {
+		httpProtocol.Handler.Handle("/batch/", http.StripPrefix("/batch", limiter.Middleware(reporter)(http.HandlerFunc(h.ServeBatchHTTP))))
+		httpProtocol.Handler.HandleFunc("/readyz", h.ServeReadyHTTP)
 	}
 
 	// configMapWatcher does not block, so start it first.
@@ -185,6 +277,7 @@ func main() {
 	if err := controller.StartInformers(ctx.Done(), informers...); err != nil {
 		logger.Fatal("Failed to start informers", zap.Error(err))
 	}
+	readinessTracker.MarkInformersSynced()
 
 	// Start blocks forever.
 	if err = h.Start(ctx); err != nil {
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// batchContentType is the media type used for the CloudEvents batched JSON
+// format (CloudEvents spec, batched-json-format.md).
+const batchContentType = "application/cloudevents-batch+json"
+
+// batchOutcome is the per-event result reported back to the caller when a
+// batch isn't accepted wholesale.
+type batchOutcome struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Accepted int            `json:"accepted"`
+	Total    int            `json:"total"`
+	Outcomes []batchOutcome `json:"outcomes,omitempty"`
+}
+
+// ServeBatchHTTP handles a POST of application/cloudevents-batch+json. Each
+// event in the batch is defaulted, dispatched to the channel, and reported
+// independently, so one malformed or rejected event doesn't fail its
+// siblings. The response is 200 if every event was accepted, 207 if some
+// were rejected (with per-index outcomes enumerated), and 400 if the batch
+// itself couldn't be parsed or if every event in it was rejected (again with
+// per-index outcomes).
+func (h *Handler) ServeBatchHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, parentSpan := trace.StartSpan(r.Context(), "mtbroker.ingress.batch")
+	defer parentSpan.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	broker, err := brokerFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, "malformed cloudevents batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outcomes := make([]batchOutcome, len(raw))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+
+	for i, item := range raw {
+		wg.Add(1)
+		go func(i int, item json.RawMessage) {
+			defer wg.Done()
+			outcome := h.dispatchBatchItem(ctx, broker, i, item)
+			mu.Lock()
+			outcomes[i] = outcome
+			if outcome.Error == "" {
+				accepted++
+			}
+			mu.Unlock()
+		}(i, item)
+	}
+	wg.Wait()
+
+	resp := batchResponse{Accepted: accepted, Total: len(raw)}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case accepted == len(raw):
+		w.WriteHeader(http.StatusOK)
+	case accepted == 0:
+		resp.Outcomes = outcomes
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		resp.Outcomes = outcomes
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Warn("failed to encode batch response", zap.Error(err))
+	}
+}
+
+// dispatchBatchItem defaults, reports, and dispatches a single event from a
+// batch to broker's channel, under its own child span so traces show
+// per-event timing within the batch's parent span. It acquires h.Limiter
+// itself: ServeBatchHTTP spawns one goroutine per item, so without a per-item
+// acquire here the outer request-level Middleware acquire does nothing to
+// bound how many items dispatch concurrently.
+func (h *Handler) dispatchBatchItem(ctx context.Context, broker types.NamespacedName, index int, raw json.RawMessage) batchOutcome {
+	ctx, span := trace.StartSpan(ctx, "mtbroker.ingress.batch.event")
+	defer span.End()
+
+	start := time.Now()
+
+	if h.Limiter != nil {
+		ok, retryAfter, release := h.Limiter.Acquire(broker)
+		if !ok {
+			h.report(broker, http.StatusTooManyRequests, 0)
+			return batchOutcome{Index: index, Error: fmt.Sprintf("ingress rate limit exceeded for this broker, retry after %s", retryAfter)}
+		}
+		defer release()
+	}
+
+	var event cloudevents.Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		h.report(broker, http.StatusBadRequest, 0)
+		return batchOutcome{Index: index, Error: err.Error()}
+	}
+
+	channelURI, err := h.Brokers.ChannelURI(broker)
+	if err != nil {
+		h.report(broker, http.StatusNotFound, 0)
+		return batchOutcome{Index: index, ID: event.ID(), Error: err.Error()}
+	}
+
+	if h.Defaulter != nil {
+		event = h.Defaulter(ctx, event)
+	}
+
+	ctx = cecontext.WithTarget(ctx, channelURI)
+	if err := h.Sender.Send(ctx, event); err != nil {
+		h.report(broker, http.StatusInternalServerError, 0)
+		return batchOutcome{Index: index, ID: event.ID(), Error: err.Error()}
+	}
+
+	if h.Readiness != nil {
+		h.Readiness.RecordDispatchSuccess()
+	}
+	h.recordEventType(ctx, broker, event)
+	h.report(broker, http.StatusAccepted, time.Since(start))
+	return batchOutcome{Index: index, ID: event.ID()}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	eventinglisters "knative.dev/eventing/pkg/client/listers/eventing/v1beta1"
+)
+
+// BrokerLister resolves the CloudEvents send target (the broker's channel
+// address) for a given broker. A Handler is given one rather than a single
+// static ChannelURI so the same process can dispatch for every Broker in
+// the cluster, not just the one it happened to start with.
+type BrokerLister interface {
+	ChannelURI(broker types.NamespacedName) (string, error)
+}
+
+type informerBrokerLister struct {
+	lister eventinglisters.BrokerLister
+}
+
+// NewBrokerLister returns a BrokerLister backed by a Broker informer's
+// lister, resolving a broker's channel address from its Status.Address,
+// which the broker reconciler only populates once the channel is ready.
+func NewBrokerLister(lister eventinglisters.BrokerLister) BrokerLister {
+	return &informerBrokerLister{lister: lister}
+}
+
+func (b *informerBrokerLister) ChannelURI(broker types.NamespacedName) (string, error) {
+	br, err := b.lister.Brokers(broker.Namespace).Get(broker.Name)
+	if err != nil {
+		return "", fmt.Errorf("ingress: failed to get broker %s: %w", broker, err)
+	}
+	if br.Status.Address.URL == nil {
+		return "", fmt.Errorf("ingress: broker %s has no ready channel address", broker)
+	}
+	return br.Status.Address.URL.String(), nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package eventtype auto-registers eventing.knative.dev/v1beta1 EventType
+// objects from the (type, source, schema, dataschema, broker) tuples
+// observed at the mtbroker ingress, so catalogs and developer portals get an
+// accurate live inventory of the schemas flowing through a broker without an
+// operator authoring EventTypes by hand.
+package eventtype
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	lru "github.com/hashicorp/golang-lru"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	eventingv1beta1 "knative.dev/eventing/pkg/apis/eventing/v1beta1"
+	clientset "knative.dev/eventing/pkg/client/clientset/versioned"
+)
+
+// defaultCacheSize bounds the in-memory LRU of tuples already reconciled, so
+// a broker with a long-running, high-cardinality workload doesn't grow this
+// unbounded. Evicted entries simply get a redundant Create the next time
+// they're seen; since makeEventType derives a deterministic Name from the
+// tuple's hash, that Create no-ops via AlreadyExists instead of creating a
+// duplicate EventType.
+const defaultCacheSize = 10000
+
+// Recorder reconciles an EventType for every distinct (type, source, schema,
+// dataschema) tuple seen for a broker. Implementations must be safe to call
+// from multiple goroutines, since the ingress dispatches concurrently.
+type Recorder interface {
+	Record(ctx context.Context, broker types.NamespacedName, event cloudevents.Event) error
+}
+
+type recorder struct {
+	eventingClient clientset.Interface
+	logger         *zap.Logger
+	seen           *lru.Cache
+}
+
+// NewRecorder builds a Recorder backed by eventingClient, deduplicating
+// reconciles with an LRU of the given size.
+func NewRecorder(eventingClient clientset.Interface, logger *zap.Logger, cacheSize int) (Recorder, error) {
+	if cacheSize <= 0 {
+		cacheSize = defaultCacheSize
+	}
+	seen, err := lru.New(cacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("eventtype: failed to build dedup cache: %w", err)
+	}
+	return &recorder{eventingClient: eventingClient, logger: logger, seen: seen}, nil
+}
+
+// Record reconciles the EventType for event's (type, source, schema,
+// dataschema) tuple against broker, skipping the API call entirely when the
+// tuple's hash is already in the dedup cache.
+func (r *recorder) Record(ctx context.Context, broker types.NamespacedName, event cloudevents.Event) error {
+	key := tupleHash(broker, event)
+	if _, ok := r.seen.Get(key); ok {
+		return nil
+	}
+
+	et := makeEventType(broker, event, key)
+	_, err := r.eventingClient.EventingV1beta1().EventTypes(broker.Namespace).Create(ctx, et, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("eventtype: failed to create EventType for broker %s: %w", broker, err)
+	}
+
+	r.seen.Add(key, struct{}{})
+	if err != nil {
+		r.logger.Debug("EventType already existed", zap.String("key", key))
+	}
+	return nil
+}
+
+// tupleHash returns a short, stable, DNS-label-safe hash of the tuple that
+// identifies a schema flowing through broker, used both as the dedup cache
+// key and to derive the EventType's generated name.
+func tupleHash(broker types.NamespacedName, event cloudevents.Event) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%s|%s|%s|%s", broker.Namespace, broker.Name, event.Type(), event.Source(), event.DataSchema())
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+func makeEventType(broker types.NamespacedName, event cloudevents.Event, key string) *eventingv1beta1.EventType {
+	return &eventingv1beta1.EventType{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", broker.Name, key),
+			Namespace: broker.Namespace,
+			Labels: map[string]string{
+				"eventing.knative.dev/broker":           broker.Name,
+				"eventing.knative.dev/autocreated-hash": key,
+			},
+			Annotations: map[string]string{
+				"eventing.knative.dev/autocreated": "true",
+			},
+		},
+		Spec: eventingv1beta1.EventTypeSpec{
+			Type:   event.Type(),
+			Source: event.Source(),
+			Schema: event.DataSchema(),
+			Broker: broker.Name,
+		},
+	}
+}
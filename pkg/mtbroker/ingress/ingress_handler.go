@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ingress implements the receive side of the multi-tenant broker:
+// accepting events over one or more CloudEvents protocol bindings, applying
+// broker-wide defaulting, and dispatching to the broker's channel.
+package ingress
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+
+	"knative.dev/eventing/pkg/mtbroker/ingress/eventtype"
+	"knative.dev/eventing/pkg/mtbroker/ingress/readiness"
+)
+
+// Defaulter mutates (a copy of) an incoming event before it is dispatched,
+// e.g. to set a default TTL. It is produced by broker.TTLDefaulter.
+type Defaulter func(ctx context.Context, event cloudevents.Event) cloudevents.Event
+
+// Handler receives CloudEvents through CeClient, defaults them, and
+// dispatches them through Sender to the broker's channel resolved from the
+// request. CeClient is built in main.go from a Protocol (see protocol.go)
+// so the receive-side transport can be swapped without touching this type;
+// Sender is always HTTP (see NewHTTPSender).
+type Handler struct {
+	// Logger is used to log traces and debug information.
+	Logger *zap.Logger
+
+	// CeClient receives events from the configured Protocol (see
+	// protocol.go). It is never used to dispatch: non-HTTP bindings
+	// (protocol_kafka_sarama.go et al.) are consume-only and, even for HTTP,
+	// the receive client isn't shaped for sending to an address resolved
+	// per request.
+	CeClient cloudevents.Client
+
+	// Sender dispatches accepted events to the broker's channel, resolved
+	// per request via Brokers.ChannelURI. It is always an HTTP client
+	// regardless of which Protocol CeClient receives on, since a channel
+	// address is always an HTTP(S) URL.
+	Sender cloudevents.Client
+
+	// Reporter reports stats for requests handled by this handler.
+	Reporter StatsReporter
+
+	// Defaulter defaults CE knative extensions.
+	Defaulter Defaulter
+
+	// Brokers resolves the channel address to dispatch to for the broker a
+	// request names, so this one Handler can front every Broker in the
+	// cluster instead of being bound to a single one.
+	Brokers BrokerLister
+
+	// Limiter bounds per-broker throughput and cluster-wide in-flight
+	// dispatches. It is applied per HTTP request by Limiter.Middleware, and
+	// again per item by ServeBatchHTTP, since a single batched request can
+	// otherwise fan out one goroutine per item with no bound at all.
+	Limiter *Limiter
+
+	// Recorder, if set, reconciles an EventType for every distinct tuple of
+	// event attributes this handler dispatches. Nil disables auto-creation
+	// (the AUTO_CREATE_EVENT_TYPES=false default).
+	Recorder eventtype.Recorder
+
+	// Readiness tracks whether this handler is ready to accept traffic. If
+	// nil, ServeReadyHTTP always reports ready.
+	Readiness *readiness.Tracker
+}
+
+// Start begins receiving events on h.CeClient and blocks until ctx is done
+// or the underlying protocol returns an error.
+func (h *Handler) Start(ctx context.Context) error {
+	return h.CeClient.StartReceive(ctx, h.serveHTTP)
+}
+
+// serveHTTP is invoked by the CloudEvents client for every event the
+// configured protocol decodes, regardless of which binding produced it. The
+// broker it's destined for is resolved from the incoming request's path
+// (the "/<namespace>/<broker>" convention the ingress Deployment is routed
+// under), not fixed per process, so one Handler fronts every Broker.
+func (h *Handler) serveHTTP(ctx context.Context, event cloudevents.Event) cloudevents.Result {
+	start := time.Now()
+
+	broker, err := brokerFromPath(cehttp.TransportContextFrom(ctx).URI.Path)
+	if err != nil {
+		h.report(broker, http.StatusNotFound, 0)
+		return cloudevents.NewHTTPResult(http.StatusNotFound, "%w", err)
+	}
+
+	channelURI, err := h.Brokers.ChannelURI(broker)
+	if err != nil {
+		h.report(broker, http.StatusNotFound, 0)
+		return cloudevents.NewHTTPResult(http.StatusNotFound, "failed to resolve broker %s: %w", broker, err)
+	}
+
+	if h.Defaulter != nil {
+		event = h.Defaulter(ctx, event)
+	}
+
+	ctx = cecontext.WithTarget(ctx, channelURI)
+	if err := h.Sender.Send(ctx, event); err != nil {
+		h.report(broker, http.StatusInternalServerError, 0)
+		return cloudevents.NewHTTPResult(http.StatusInternalServerError, "failed to dispatch event: %w", err)
+	}
+
+	if h.Readiness != nil {
+		h.Readiness.RecordDispatchSuccess()
+	}
+	h.recordEventType(ctx, broker, event)
+	h.report(broker, http.StatusAccepted, time.Since(start))
+	return cloudevents.ResultACK
+}
+
+// ServeReadyHTTP backs /readyz: 200 once h.Readiness reports ready, 503
+// (with the reason as the body) otherwise.
+func (h *Handler) ServeReadyHTTP(w http.ResponseWriter, _ *http.Request) {
+	if h.Readiness == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if ready, reason := h.Readiness.Ready(); !ready {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// recordEventType asks h.Recorder to reconcile an EventType for event
+// against broker, when auto-creation is enabled. Failures are logged, not
+// surfaced to the caller: a broken EventType reconcile shouldn't fail event
+// delivery.
+func (h *Handler) recordEventType(ctx context.Context, broker types.NamespacedName, event cloudevents.Event) {
+	if h.Recorder == nil {
+		return
+	}
+	if err := h.Recorder.Record(ctx, broker, event); err != nil {
+		h.Logger.Warn("failed to record EventType", zap.Error(err))
+	}
+}
+
+// report records the outcome of a dispatch against broker, logging rather
+// than failing the request if the stats backend itself errors.
+func (h *Handler) report(broker types.NamespacedName, responseCode int, dispatchTime time.Duration) {
+	args := ReportArgs{Namespace: broker.Namespace, Broker: broker.Name}
+	if err := h.Reporter.ReportEventCount(args, responseCode); err != nil {
+		h.Logger.Warn("failed to report event count", zap.Error(err))
+	}
+	if dispatchTime > 0 {
+		if err := h.Reporter.ReportDispatchTime(args, responseCode, dispatchTime); err != nil {
+			h.Logger.Warn("failed to report dispatch time", zap.Error(err))
+		}
+	}
+}
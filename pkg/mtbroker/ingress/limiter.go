@@ -0,0 +1,132 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/trace"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// LimiterConfig configures Limiter. QPS and Burst bound each
+// (namespace, broker) scope's own token bucket; MaxInFlight bounds the
+// number of requests in dispatch concurrently across every scope, so one
+// noisy tenant can't starve the others by holding the ingress's goroutines
+// and connections to the channel.
+type LimiterConfig struct {
+	QPS         float64
+	Burst       int
+	MaxInFlight int64
+}
+
+// Limiter enforces LimiterConfig. It is safe for concurrent use.
+type Limiter struct {
+	cfg LimiterConfig
+
+	mu       sync.Mutex
+	perScope map[types.NamespacedName]*rate.Limiter
+
+	inFlight int64
+}
+
+// NewLimiter builds a Limiter from cfg. A zero-value MaxInFlight disables
+// the global in-flight cap; a zero-value QPS disables per-scope rate
+// limiting (Burst is then irrelevant).
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	return &Limiter{cfg: cfg, perScope: make(map[types.NamespacedName]*rate.Limiter)}
+}
+
+// Acquire admits one request for scope, returning ok=false and a
+// Retry-After duration when either the scope's token bucket or the global
+// in-flight cap is exhausted. When ok is true, the caller must call release
+// once the request finishes to free its in-flight slot.
+func (l *Limiter) Acquire(scope types.NamespacedName) (ok bool, retryAfter time.Duration, release func()) {
+	var reservation *rate.Reservation
+	if l.cfg.QPS > 0 {
+		reservation = l.scopeLimiter(scope).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			return false, delay, nil
+		}
+	}
+
+	if l.cfg.MaxInFlight > 0 {
+		if atomic.AddInt64(&l.inFlight, 1) > l.cfg.MaxInFlight {
+			atomic.AddInt64(&l.inFlight, -1)
+			if reservation != nil {
+				reservation.Cancel()
+			}
+			return false, time.Second, nil
+		}
+		return true, 0, func() { atomic.AddInt64(&l.inFlight, -1) }
+	}
+
+	return true, 0, func() {}
+}
+
+// Middleware returns HTTP middleware that resolves the broker a request
+// names from its "/<namespace>/<broker>" path and applies Acquire for that
+// scope, rejecting with 429 and a Retry-After header when the request isn't
+// admitted, and reporting a throttled-count metric plus a trace span event
+// so traces make the rejection visible. Intended to be passed to
+// cehttp.WithMiddleware alongside the tracing middleware, ahead of event
+// decoding, so a throttled request never reaches the channel.
+func (l *Limiter) Middleware(reporter StatsReporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, err := brokerFromPath(r.URL.Path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			ok, retryAfter, release := l.Acquire(scope)
+			if !ok {
+				trace.FromContext(r.Context()).Annotate(
+					[]trace.Attribute{trace.StringAttribute("broker", scope.String())},
+					"ingress rate limit exceeded",
+				)
+				// A reporting failure here isn't actionable; the request is
+				// still 429'd below regardless.
+				_ = reporter.ReportThrottledCount(ReportArgs{Namespace: scope.Namespace, Broker: scope.Name})
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, "ingress rate limit exceeded for this broker", http.StatusTooManyRequests)
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *Limiter) scopeLimiter(scope types.NamespacedName) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.perScope[scope]
+	if !ok {
+		lim = rate.NewLimiter(rate.Limit(l.cfg.QPS), l.cfg.Burst)
+		l.perScope[scope] = lim
+	}
+	return lim
+}
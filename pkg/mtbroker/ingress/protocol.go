@@ -0,0 +1,124 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	pkgtracing "knative.dev/pkg/tracing"
+)
+
+// ProtocolEnv carries the pieces of envConfig that protocol factories need in
+// order to construct a binding. It is deliberately narrower than the full
+// envConfig so that adding a new protocol-specific env var doesn't require
+// touching every factory's signature. Factories for bindings other than HTTP
+// (Kafka, AMQP, MQTT; see protocol_kafka_sarama.go et al.) process their own
+// envconfig structs directly rather than extending this one.
+type ProtocolEnv struct {
+	// Port is the port the HTTP binding listens on. Ignored by non-HTTP
+	// factories.
+	Port int
+
+	// MaxIdleConns and MaxIdleConnsPerHost tune the HTTP binding's
+	// underlying transport. The ingress only ever dials its own channel, so
+	// these are set equal and high enough to avoid connection churn under
+	// load.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// Middleware are applied (in order, innermost first) around the HTTP
+	// binding's request handling, ahead of pkgtracing.HTTPSpanMiddleware.
+	// Used to hang cross-cutting concerns like rate limiting in front of
+	// event decoding. Ignored by non-HTTP factories.
+	Middleware []cehttp.Middleware
+}
+
+// ProtocolFactory constructs the cloudevents.Protocol binding the ingress
+// receives events on. The default factory wires up HTTP; additional
+// bindings are registered from build-tag-gated files in this package
+// (protocol_kafka_sarama.go, protocol_amqp.go, protocol_mqtt.go) so that
+// operators can opt a binary into a transport without paying for its
+// dependencies when they don't need it.
+type ProtocolFactory func(ctx context.Context, env ProtocolEnv) (cloudevents.Protocol, error)
+
+// protocolFactories is populated by this file's init and by the init of any
+// build-tag-gated sibling file compiled into the binary.
+var protocolFactories = map[string]ProtocolFactory{}
+
+// RegisterProtocol makes a named ProtocolFactory available to NewProtocol.
+// Build-tag-gated files call this from their own init().
+func RegisterProtocol(name string, f ProtocolFactory) {
+	protocolFactories[name] = f
+}
+
+func init() {
+	RegisterProtocol("http", newHTTPProtocol)
+}
+
+// NewProtocol looks up the factory registered under name (falling back to
+// "http" when name is empty) and invokes it. It returns an error rather than
+// falling back silently when name is set but unknown, since that almost
+// always means the binary was built without the corresponding build tag.
+func NewProtocol(ctx context.Context, name string, env ProtocolEnv) (cloudevents.Protocol, error) {
+	if name == "" {
+		name = "http"
+	}
+	f, ok := protocolFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("mtbroker ingress: no protocol binding registered for %q (binary may need to be built with its build tag)", name)
+	}
+	return f(ctx, env)
+}
+
+// NewHTTPSender builds the cloudevents.Client used to dispatch to a
+// broker's channel. It is always HTTP, independent of the ProtocolFactory
+// env.Protocol selects for receiving: a channel address is always an
+// HTTP(S) URL, and non-HTTP receive bindings (protocol_kafka_sarama.go et
+// al.) are consume-only and couldn't send even if asked to.
+func NewHTTPSender(env ProtocolEnv) (cloudevents.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = env.MaxIdleConns
+	transport.MaxIdleConnsPerHost = env.MaxIdleConnsPerHost
+
+	p, err := cehttp.New(cehttp.WithClient(http.Client{Transport: transport}))
+	if err != nil {
+		return nil, err
+	}
+	return cloudevents.NewClient(p, cloudevents.WithUUIDs(), cloudevents.WithTimeNow())
+}
+
+// newHTTPProtocol is the default ProtocolFactory, preserving the ingress's
+// historical behaviour of a plain HTTP receiver with span middleware and a
+// transport tuned for repeatedly dialing the same channel.
+func newHTTPProtocol(_ context.Context, env ProtocolEnv) (cloudevents.Protocol, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = env.MaxIdleConns
+	transport.MaxIdleConnsPerHost = env.MaxIdleConnsPerHost
+
+	middleware := append(append([]cehttp.Middleware{}, env.Middleware...), pkgtracing.HTTPSpanMiddleware)
+
+	return cehttp.New(
+		cehttp.WithPort(env.Port),
+		cehttp.WithMiddleware(middleware...),
+		cehttp.WithClient(http.Client{Transport: transport}),
+	)
+}
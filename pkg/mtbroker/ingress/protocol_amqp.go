@@ -0,0 +1,45 @@
+// +build amqp
+
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/protocol/amqp/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/kelseyhightower/envconfig"
+)
+
+func init() {
+	RegisterProtocol("amqp", newAMQPProtocol)
+}
+
+type amqpEnv struct {
+	ServerURL string `envconfig:"AMQP_SERVER_URL" required:"true"`
+	Node      string `envconfig:"AMQP_NODE" required:"true"`
+}
+
+func newAMQPProtocol(ctx context.Context, _ ProtocolEnv) (cloudevents.Protocol, error) {
+	var env amqpEnv
+	if err := envconfig.Process("", &env); err != nil {
+		return nil, fmt.Errorf("mtbroker ingress: failed to process amqp env vars: %w", err)
+	}
+	return amqp.NewProtocol(env.ServerURL, env.Node, amqp.ConnOption{}, amqp.SessionOption{})
+}
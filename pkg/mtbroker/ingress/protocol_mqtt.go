@@ -0,0 +1,45 @@
+// +build mqtt
+
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/protocol/mqtt_paho/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/kelseyhightower/envconfig"
+)
+
+func init() {
+	RegisterProtocol("mqtt", newMQTTProtocol)
+}
+
+type mqttEnv struct {
+	BrokerURL string `envconfig:"MQTT_BROKER_URL" required:"true"`
+	Topic     string `envconfig:"MQTT_INGRESS_TOPIC" required:"true"`
+}
+
+func newMQTTProtocol(ctx context.Context, _ ProtocolEnv) (cloudevents.Protocol, error) {
+	var env mqttEnv
+	if err := envconfig.Process("", &env); err != nil {
+		return nil, fmt.Errorf("mtbroker ingress: failed to process mqtt env vars: %w", err)
+	}
+	return mqtt_paho.New(ctx, env.BrokerURL, env.Topic)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package readiness tracks the preconditions the mtbroker ingress needs
+// before it can safely accept traffic, so /readyz can 503 a pod that would
+// otherwise 5xx on unsynced informers or a dead channel.
+package readiness
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker aggregates the three signals /readyz gates on: informer sync,
+// having observed at least one snapshot of every config map it's told to
+// expect, and a recent successful dispatch to the target channel. It's a
+// plain struct (not wired to any HTTP type) so tests can drive it directly
+// without standing up a server.
+type Tracker struct {
+	mu sync.RWMutex
+
+	informersSynced bool
+	configMapsSeen  map[string]struct{}
+	lastDispatch    time.Time
+
+	configMapNames []string
+	window         time.Duration
+	start          time.Time
+	now            func() time.Time
+}
+
+// NewTracker returns a Tracker that considers a dispatch stale after window
+// has elapsed since the last success. Before any dispatch has ever
+// succeeded, the same window is used as a startup grace period so a
+// freshly-started pod with synced informers isn't immediately marked
+// unready for want of traffic. Ready doesn't hold until MarkConfigMapSeen
+// has been called for every name in configMapNames, so a pod whose
+// config-map watcher has only delivered some of the snapshots it's
+// subscribed to isn't reported ready.
+func NewTracker(window time.Duration, configMapNames ...string) *Tracker {
+	return &Tracker{
+		window:         window,
+		start:          time.Now(),
+		now:            time.Now,
+		configMapsSeen: make(map[string]struct{}, len(configMapNames)),
+		configMapNames: configMapNames,
+	}
+}
+
+// MarkInformersSynced records that controller.StartInformers has completed.
+func (t *Tracker) MarkInformersSynced() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.informersSynced = true
+}
+
+// MarkConfigMapSeen records that the configMapWatcher has delivered a
+// snapshot of the config map called name.
+func (t *Tracker) MarkConfigMapSeen(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.configMapsSeen == nil {
+		t.configMapsSeen = make(map[string]struct{}, 1)
+	}
+	t.configMapsSeen[name] = struct{}{}
+}
+
+// configMapsReady reports whether every name passed to NewTracker has been
+// through MarkConfigMapSeen. Callers must hold t.mu.
+func (t *Tracker) configMapsReady() bool {
+	for _, name := range t.configMapNames {
+		if _, ok := t.configMapsSeen[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordDispatchSuccess records that an event was just dispatched to the
+// channel successfully.
+func (t *Tracker) RecordDispatchSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastDispatch = t.now()
+}
+
+// Ready reports whether the tracked preconditions currently hold, and if
+// not, a short reason suitable for logging or as a probe response body.
+func (t *Tracker) Ready() (bool, string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if !t.informersSynced {
+		return false, "informers not yet synced"
+	}
+	if !t.configMapsReady() {
+		return false, "not every expected config map snapshot observed yet"
+	}
+
+	now := t.now()
+	if t.lastDispatch.IsZero() {
+		if now.Sub(t.start) > t.window {
+			return false, "no successful channel dispatch within startup grace period"
+		}
+		return true, ""
+	}
+	if now.Sub(t.lastDispatch) > t.window {
+		return false, "no successful channel dispatch within probe window"
+	}
+	return true, ""
+}
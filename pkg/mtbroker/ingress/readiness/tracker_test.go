@@ -0,0 +1,130 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readiness
+
+import (
+	"testing"
+	"time"
+)
+
+var testConfigMapNames = []string{"logging", "metrics", "tracing"}
+
+// newTestTracker builds a Tracker with a fake clock pinned at start, bypassing
+// NewTracker so tests can advance time deterministically instead of sleeping.
+func newTestTracker(window time.Duration, start time.Time) (*Tracker, *time.Time) {
+	clock := start
+	t := &Tracker{
+		window:         window,
+		start:          start,
+		now:            func() time.Time { return clock },
+		configMapsSeen: make(map[string]struct{}),
+		configMapNames: testConfigMapNames,
+	}
+	return t, &clock
+}
+
+func markAllConfigMapsSeen(t *Tracker) {
+	for _, name := range testConfigMapNames {
+		t.MarkConfigMapSeen(name)
+	}
+}
+
+func TestTrackerNotReadyUntilInformersSynced(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, _ := newTestTracker(time.Minute, start)
+	markAllConfigMapsSeen(tr)
+
+	if ready, reason := tr.Ready(); ready {
+		t.Fatalf("expected not ready before informers synced, got ready (reason %q)", reason)
+	}
+}
+
+func TestTrackerNotReadyUntilAllConfigMapsSeen(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, _ := newTestTracker(time.Minute, start)
+	tr.MarkInformersSynced()
+
+	if ready, reason := tr.Ready(); ready {
+		t.Fatalf("expected not ready before any config map seen, got ready (reason %q)", reason)
+	}
+
+	// Seeing some, but not all, of the expected config maps still isn't enough.
+	tr.MarkConfigMapSeen("logging")
+	tr.MarkConfigMapSeen("metrics")
+	if ready, reason := tr.Ready(); ready {
+		t.Fatalf("expected not ready with one config map unseen, got ready (reason %q)", reason)
+	}
+
+	tr.MarkConfigMapSeen("tracing")
+	if ready, reason := tr.Ready(); !ready {
+		t.Fatalf("expected ready once every config map is seen (still within grace period): %s", reason)
+	}
+}
+
+func TestTrackerReadyWithinStartupGracePeriod(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, clock := newTestTracker(time.Minute, start)
+	tr.MarkInformersSynced()
+	markAllConfigMapsSeen(tr)
+
+	*clock = start.Add(30 * time.Second)
+	if ready, reason := tr.Ready(); !ready {
+		t.Fatalf("expected ready within startup grace period, got not ready: %s", reason)
+	}
+}
+
+func TestTrackerNotReadyAfterGracePeriodWithNoDispatch(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, clock := newTestTracker(time.Minute, start)
+	tr.MarkInformersSynced()
+	markAllConfigMapsSeen(tr)
+
+	*clock = start.Add(2 * time.Minute)
+	if ready, reason := tr.Ready(); ready {
+		t.Fatalf("expected not ready once startup grace period elapses with no dispatch, got ready (reason %q)", reason)
+	}
+}
+
+func TestTrackerReadyShortlyAfterDispatch(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, clock := newTestTracker(time.Minute, start)
+	tr.MarkInformersSynced()
+	markAllConfigMapsSeen(tr)
+
+	*clock = start.Add(5 * time.Minute)
+	tr.RecordDispatchSuccess()
+	*clock = clock.Add(30 * time.Second)
+
+	if ready, reason := tr.Ready(); !ready {
+		t.Fatalf("expected ready shortly after a successful dispatch, got not ready: %s", reason)
+	}
+}
+
+func TestTrackerNotReadyOnceDispatchGoesStale(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr, clock := newTestTracker(time.Minute, start)
+	tr.MarkInformersSynced()
+	markAllConfigMapsSeen(tr)
+
+	*clock = start.Add(5 * time.Minute)
+	tr.RecordDispatchSuccess()
+	*clock = clock.Add(2 * time.Minute)
+
+	if ready, reason := tr.Ready(); ready {
+		t.Fatalf("expected not ready once the last dispatch is older than the probe window, got ready (reason %q)", reason)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// brokerFromPath parses the "/<namespace>/<broker>" path every request
+// (single-event, batch, or rate-limited) is routed under, so one shared
+// ingress process can front every Broker in the cluster rather than being
+// bound to a single Broker for its whole lifetime.
+func brokerFromPath(path string) (types.NamespacedName, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf(`ingress: path %q is not of the form "/<namespace>/<broker>"`, path)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2020 The Knative Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingress
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	eventCountM = stats.Int64(
+		"event_count",
+		"Number of events received by the ingress",
+		stats.UnitDimensionless,
+	)
+	dispatchDurationM = stats.Float64(
+		"event_dispatch_latencies",
+		"The time spent dispatching an accepted event to the broker's channel",
+		stats.UnitMilliseconds,
+	)
+	throttledCountM = stats.Int64(
+		"event_throttled_count",
+		"Number of events rejected by the ingress rate limiter",
+		stats.UnitDimensionless,
+	)
+
+	containerKey    = tag.MustNewKey("container_name")
+	podKey          = tag.MustNewKey("unique_name")
+	namespaceKey    = tag.MustNewKey("namespace_name")
+	brokerKey       = tag.MustNewKey("broker_name")
+	responseCodeKey = tag.MustNewKey("response_code")
+)
+
+// StatsReporter reports ingress requests.
+type StatsReporter interface {
+	ReportEventCount(ctx ReportArgs, responseCode int) error
+	ReportDispatchTime(ctx ReportArgs, responseCode int, d time.Duration) error
+	ReportThrottledCount(ctx ReportArgs) error
+}
+
+// ReportArgs defines the dimensions to report for a given event.
+type ReportArgs struct {
+	Namespace string
+	Broker    string
+}
+
+type reporter struct {
+	container string
+	pod       string
+}
+
+// NewStatsReporter creates a reporter that derives its resource labels from
+// the ingress's container and pod names, matching the other mtbroker
+// components' reporters.
+func NewStatsReporter(container, pod string) StatsReporter {
+	return &reporter{container: container, pod: pod}
+}
+
+func (r *reporter) ReportEventCount(args ReportArgs, responseCode int) error {
+	ctx, err := r.tagContext(args, responseCode)
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, eventCountM.M(1))
+	return nil
+}
+
+func (r *reporter) ReportDispatchTime(args ReportArgs, responseCode int, d time.Duration) error {
+	ctx, err := r.tagContext(args, responseCode)
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, dispatchDurationM.M(float64(d/time.Millisecond)))
+	return nil
+}
+
+func (r *reporter) ReportThrottledCount(args ReportArgs) error {
+	ctx, err := r.tagContext(args, http.StatusTooManyRequests)
+	if err != nil {
+		return err
+	}
+	stats.Record(ctx, throttledCountM.M(1))
+	return nil
+}
+
+func (r *reporter) tagContext(args ReportArgs, responseCode int) (context.Context, error) {
+	return tag.New(
+		context.Background(),
+		tag.Insert(containerKey, r.container),
+		tag.Insert(podKey, r.pod),
+		tag.Insert(namespaceKey, args.Namespace),
+		tag.Insert(brokerKey, args.Broker),
+		tag.Insert(responseCodeKey, responseCodeString(responseCode)),
+	)
+}
+
+func responseCodeString(code int) string {
+	return strconv.Itoa(code)
+}